@@ -59,11 +59,22 @@ const (
 	QUO
 	POWER
 	MODULO
+	IDENT
+	COMMA
+	BAND
+	BOR
+	BXOR
+	BNOT
+	SHL
+	SHR
 )
 
 type Token struct {
-	Typ   TokenType
-	Value string
+	Typ    TokenType
+	Value  string
+	Line   int
+	Col    int
+	Offset int
 }
 
 func (t Token) String() string {
@@ -93,6 +104,22 @@ func (t Token) String() string {
 		typName = "POWER"
 	case MODULO:
 		typName = "MODULO"
+	case IDENT:
+		typName = "IDENT"
+	case COMMA:
+		typName = "COMMA"
+	case BAND:
+		typName = "BAND"
+	case BOR:
+		typName = "BOR"
+	case BXOR:
+		typName = "BXOR"
+	case BNOT:
+		typName = "BNOT"
+	case SHL:
+		typName = "SHL"
+	case SHR:
+		typName = "SHR"
 	default:
 		typName = "UNKNOWN"
 	}
@@ -109,73 +136,238 @@ func NewScanner(s string) *Scanner {
 	return &Scanner{s: []rune(s)}
 }
 
+// scan reads the next token, recording the line, column, and rune offset
+// where it starts so later parse errors can point back into the source.
 func (sc *Scanner) scan() Token {
+	startPos := sc.pos
+	typ, value := sc.scanToken()
+	line, col := sc.lineCol(startPos)
+	return Token{Typ: typ, Value: value, Line: line, Col: col, Offset: startPos}
+}
+
+// lineCol converts a rune offset into 1-based line/column coordinates.
+func (sc *Scanner) lineCol(at int) (line, col int) {
+	line, col = 1, 1
+	for i := 0; i < at && i < len(sc.s); i++ {
+		if sc.s[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+func (sc *Scanner) scanToken() (TokenType, string) {
 	if sc.pos >= len(sc.s) {
-		return Token{Typ: EOF}
+		return EOF, ""
 	}
 	if unicode.IsSpace(sc.s[sc.pos]) {
 		start := sc.pos
 		for sc.pos < len(sc.s) && unicode.IsSpace(sc.s[sc.pos]) {
 			sc.pos++
 		}
-		return Token{Typ: WS, Value: string(sc.s[start:sc.pos])}
+		return WS, string(sc.s[start:sc.pos])
 	}
 
 	if sc.pos+1 < len(sc.s) && sc.s[sc.pos] == '*' && sc.s[sc.pos+1] == '*' {
 		sc.pos += 2
-		return Token{Typ: POWER, Value: "**"}
+		return POWER, "**"
+	}
+	if sc.pos+1 < len(sc.s) && sc.s[sc.pos] == '<' && sc.s[sc.pos+1] == '<' {
+		sc.pos += 2
+		return SHL, "<<"
+	}
+	if sc.pos+1 < len(sc.s) && sc.s[sc.pos] == '>' && sc.s[sc.pos+1] == '>' {
+		sc.pos += 2
+		return SHR, ">>"
 	}
 
 	ch := sc.s[sc.pos]
 	start := sc.pos
 
-	if unicode.IsDigit(ch) {
-		sc.pos++
-		for sc.pos < len(sc.s) && unicode.IsDigit(sc.s[sc.pos]) {
-			sc.pos++
-		}
-		if sc.pos < len(sc.s) && sc.s[sc.pos] == '.' {
-			if sc.pos+1 >= len(sc.s) || !unicode.IsDigit(sc.s[sc.pos+1]) {
-				sc.pos++
-				return Token{Typ: ILLEGAL, Value: string(sc.s[start:sc.pos])}
-			}
-			sc.pos++
-			for sc.pos < len(sc.s) && unicode.IsDigit(sc.s[sc.pos]) {
-				sc.pos++
-			}
-		}
-		return Token{Typ: NUM, Value: string(sc.s[start:sc.pos])}
-	} else if ch == '.' {
-		if sc.pos+1 >= len(sc.s) || !unicode.IsDigit(sc.s[sc.pos+1]) {
-			sc.pos++
-			return Token{Typ: ILLEGAL, Value: string(sc.s[start:sc.pos])}
-		}
+	if unicode.IsDigit(ch) || (ch == '.' && sc.pos+1 < len(sc.s) && unicode.IsDigit(sc.s[sc.pos+1])) {
+		return sc.scanNumber()
+	}
+
+	if isIdentStart(ch) {
 		sc.pos++
-		for sc.pos < len(sc.s) && unicode.IsDigit(sc.s[sc.pos]) {
+		for sc.pos < len(sc.s) && isIdentPart(sc.s[sc.pos]) {
 			sc.pos++
 		}
-		return Token{Typ: NUM, Value: string(sc.s[start:sc.pos])}
+		return IDENT, string(sc.s[start:sc.pos])
 	}
 
 	valStr := string(ch)
 	sc.pos++
 	switch ch {
 	case '(':
-		return Token{Typ: LPAREN, Value: valStr}
+		return LPAREN, valStr
 	case ')':
-		return Token{Typ: RPAREN, Value: valStr}
+		return RPAREN, valStr
 	case '+':
-		return Token{Typ: ADD, Value: valStr}
+		return ADD, valStr
 	case '-':
-		return Token{Typ: SUB, Value: valStr}
+		return SUB, valStr
 	case '*':
-		return Token{Typ: MUL, Value: valStr}
+		return MUL, valStr
 	case '/':
-		return Token{Typ: QUO, Value: valStr}
+		return QUO, valStr
 	case '%':
-		return Token{Typ: MODULO, Value: valStr}
+		return MODULO, valStr
+	case ',':
+		return COMMA, valStr
+	case '&':
+		return BAND, valStr
+	case '|':
+		return BOR, valStr
+	case '^':
+		return BXOR, valStr
+	case '~':
+		return BNOT, valStr
 	}
-	return Token{Typ: ILLEGAL, Value: valStr}
+	return ILLEGAL, valStr
+}
+
+// scanNumber scans a numeric literal starting at sc.pos, which may be a
+// decimal integer or float (optionally with an exponent and `_` digit
+// separators, e.g. "1_000.000_1e-3") or a base-prefixed integer ("0x1A",
+// "0b101", "0o17"). The candidate text is validated with big.Rat.SetString
+// so malformed forms like "1__2", a trailing "_", or "0x" with no digits
+// come back as an ILLEGAL token rather than a NUM that fails to parse later.
+func (sc *Scanner) scanNumber() (TokenType, string) {
+	start := sc.pos
+
+	if sc.s[sc.pos] == '0' && sc.pos+1 < len(sc.s) {
+		var isBaseDigit func(rune) bool
+		switch sc.s[sc.pos+1] {
+		case 'x', 'X':
+			isBaseDigit = isHexDigit
+		case 'o', 'O':
+			isBaseDigit = isOctDigit
+		case 'b', 'B':
+			isBaseDigit = isBinDigit
+		}
+		if isBaseDigit != nil {
+			sc.pos += 2
+			for sc.pos < len(sc.s) && (isBaseDigit(sc.s[sc.pos]) || sc.s[sc.pos] == '_') {
+				sc.pos++
+			}
+			return sc.finishNumber(start)
+		}
+	}
+
+	sc.scanDigits()
+	if sc.pos < len(sc.s) && sc.s[sc.pos] == '.' {
+		sc.pos++
+		sc.scanDigits()
+	}
+	if sc.pos < len(sc.s) && (sc.s[sc.pos] == 'e' || sc.s[sc.pos] == 'E') {
+		savedPos := sc.pos
+		sc.pos++
+		if sc.pos < len(sc.s) && (sc.s[sc.pos] == '+' || sc.s[sc.pos] == '-') {
+			sc.pos++
+		}
+		digitsStart := sc.pos
+		sc.scanDigits()
+		if sc.pos == digitsStart {
+			sc.pos = savedPos
+		}
+	}
+	return sc.finishNumber(start)
+}
+
+// scanDigits consumes a run of decimal digits and `_` separators.
+func (sc *Scanner) scanDigits() {
+	for sc.pos < len(sc.s) && (unicode.IsDigit(sc.s[sc.pos]) || sc.s[sc.pos] == '_') {
+		sc.pos++
+	}
+}
+
+func (sc *Scanner) finishNumber(start int) (TokenType, string) {
+	text := string(sc.s[start:sc.pos])
+	if _, ok := new(big.Rat).SetString(text); !ok {
+		return ILLEGAL, text
+	}
+	return NUM, text
+}
+
+func isHexDigit(ch rune) bool {
+	return unicode.IsDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func isOctDigit(ch rune) bool {
+	return ch >= '0' && ch <= '7'
+}
+
+func isBinDigit(ch rune) bool {
+	return ch == '0' || ch == '1'
+}
+
+func isIdentStart(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
+}
+
+func isIdentPart(ch rune) bool {
+	return isIdentStart(ch) || unicode.IsDigit(ch)
+}
+
+// ParseError is produced by the scanning and parsing that Parse drives when
+// a token of the expression cannot be processed; Parse returns it either
+// directly or wrapped, so retrieve it with errors.As. An input with no
+// tokens at all yields a plain error, not a ParseError. It carries enough
+// position information for callers to programmatically locate the problem
+// in multi-line input, and its Error() string renders a caret snippet
+// pointing at the offending rune.
+type ParseError struct {
+	Msg    string
+	Line   int
+	Col    int
+	Offset int
+	Source string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+	if snippet := renderSnippet(e.Source, e.Line, e.Col); snippet != "" {
+		msg += "\n" + snippet
+	}
+	return msg
+}
+
+func newParseError(source string, tok Token, format string, args ...any) *ParseError {
+	return &ParseError{
+		Msg:    fmt.Sprintf(format, args...),
+		Line:   tok.Line,
+		Col:    tok.Col,
+		Offset: tok.Offset,
+		Source: source,
+	}
+}
+
+// renderSnippet renders the source line containing line:col with a caret
+// ("^") under the offending column, e.g.:
+//
+//	1 + * 2
+//	    ^
+func renderSnippet(source string, line, col int) string {
+	if source == "" {
+		return ""
+	}
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	lineText := lines[line-1]
+	pad := col - 1
+	if pad < 0 {
+		pad = 0
+	}
+	if runeLen := len([]rune(lineText)); pad > runeLen {
+		pad = runeLen
+	}
+	return lineText + "\n" + strings.Repeat(" ", pad) + "^"
 }
 
 func scanAll(s string) ([]Token, error) {
@@ -184,7 +376,7 @@ func scanAll(s string) ([]Token, error) {
 	for {
 		t := scanner.scan()
 		if t.Typ == ILLEGAL {
-			return nil, fmt.Errorf("illegal token encountered %q near position %d", t.Value, scanner.pos)
+			return nil, newParseError(s, t, "illegal token %q", t.Value)
 		}
 		if t.Typ != WS {
 			tokens = append(tokens, t)
@@ -196,9 +388,84 @@ func scanAll(s string) ([]Token, error) {
 	return tokens, nil
 }
 
+// Node is implemented by every AST node produced by the parser. Parsing and
+// evaluation are separate phases: Parse builds a Node tree, and Eval walks
+// it against an Env to produce a value.
+type Node interface {
+	isNode()
+}
+
+// NumLit is a literal numeric value, already resolved to an exact rational.
+type NumLit struct {
+	Value *big.Rat
+}
+
+func (NumLit) isNode() {}
+
+// BinaryOp is a two-operand operator application, e.g. `lhs + rhs`.
+type BinaryOp struct {
+	Op  TokenType
+	LHS Node
+	RHS Node
+}
+
+func (BinaryOp) isNode() {}
+
+// UnaryOp is a single-operand prefix operator application, e.g. `-x`.
+type UnaryOp struct {
+	Op TokenType
+	X  Node
+}
+
+func (UnaryOp) isNode() {}
+
+// Paren wraps an expression that was parenthesized in the source. It
+// evaluates the same as its inner node; it exists so pretty-printers and
+// other tree consumers can reproduce the original grouping.
+type Paren struct {
+	X Node
+}
+
+func (Paren) isNode() {}
+
+// Ident is a symbol reference resolved against an Env at evaluation time.
+type Ident struct {
+	Name string
+}
+
+func (Ident) isNode() {}
+
+// Call is a function call, e.g. `sqrt(x)` or `max(a, b, c)`.
+type Call struct {
+	Name string
+	Args []Node
+}
+
+func (Call) isNode() {}
+
+// Func is the signature a built-in or user-registered function must satisfy
+// to be callable from an expression.
+type Func func(args ...*big.Rat) (*big.Rat, error)
+
+// FuncRegistry maps callable names to their implementations.
+type FuncRegistry map[string]Func
+
+// Env carries the bindings available while evaluating a Node tree.
+type Env struct {
+	// Vars holds variable bindings available to Ident nodes.
+	Vars map[string]*big.Rat
+	// Funcs holds function bindings available to Call nodes, consulted
+	// before falling back to DefaultFuncs.
+	Funcs FuncRegistry
+}
+
 type Parser struct {
 	tokens []Token
 	pos    int
+	// source is the original expression text, kept only to render caret
+	// snippets in parse errors. It may be empty for parsers constructed
+	// directly from a token list, in which case errors omit the snippet.
+	source string
 }
 
 func NewParser(tokens []Token) *Parser {
@@ -215,107 +482,153 @@ func (p *Parser) peek() Token {
 func (p *Parser) consume(expected TokenType) (Token, error) {
 	t := p.peek()
 	if t.Typ == EOF && expected != EOF {
-		return t, fmt.Errorf("unexpected EOF")
+		return t, newParseError(p.source, t, "unexpected EOF")
 	}
 	if t.Typ != expected {
-		return t, fmt.Errorf("unexpected Token")
+		return t, newParseError(p.source, t, "unexpected token %s", t)
 	}
 	p.pos++
 	return t, nil
 }
 
-func (p *Parser) parseExpression() (*big.Rat, error) {
-	lhs, err := p.parseTerm()
+// parseBitOr is the grammar's top-level rule: `|` binds loosest, below `^`,
+// which binds below `&`, which binds below the shift operators, which in
+// turn bind below additive `+`/`-` (the same precedence order C uses).
+func (p *Parser) parseBitOr() (Node, error) {
+	lhs, err := p.parseBitXor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().Typ == BOR {
+		p.consume(BOR)
+		rhs, err := p.parseBitXor()
+		if err != nil {
+			return nil, err
+		}
+		lhs = BinaryOp{Op: BOR, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *Parser) parseBitXor() (Node, error) {
+	lhs, err := p.parseBitAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().Typ == BXOR {
+		p.consume(BXOR)
+		rhs, err := p.parseBitAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = BinaryOp{Op: BXOR, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *Parser) parseBitAnd() (Node, error) {
+	lhs, err := p.parseShift()
 	if err != nil {
-		return new(big.Rat), err
+		return nil, err
+	}
+
+	for p.peek().Typ == BAND {
+		p.consume(BAND)
+		rhs, err := p.parseShift()
+		if err != nil {
+			return nil, err
+		}
+		lhs = BinaryOp{Op: BAND, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *Parser) parseShift() (Node, error) {
+	lhs, err := p.parseExpression()
+	if err != nil {
+		return nil, err
 	}
 
 	for {
 		t := p.peek()
 		switch t.Typ {
-		case ADD:
+		case SHL, SHR:
 			p.consume(t.Typ)
-			rhs, err := p.parseTerm()
+			rhs, err := p.parseExpression()
 			if err != nil {
-				return new(big.Rat), err
+				return nil, err
 			}
-			lhs.Add(lhs, rhs)
-		case SUB:
+			lhs = BinaryOp{Op: t.Typ, LHS: lhs, RHS: rhs}
+		default:
+			return lhs, nil
+		}
+	}
+}
+
+func (p *Parser) parseExpression() (Node, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		switch t.Typ {
+		case ADD, SUB:
 			p.consume(t.Typ)
 			rhs, err := p.parseTerm()
 			if err != nil {
-				return new(big.Rat), err
+				return nil, err
 			}
-			lhs.Sub(lhs, rhs) // BUG FIX: Add -> Sub
+			lhs = BinaryOp{Op: t.Typ, LHS: lhs, RHS: rhs}
 		default:
 			return lhs, nil
 		}
 	}
 }
 
-func (p *Parser) parseTerm() (*big.Rat, error) {
+func (p *Parser) parseTerm() (Node, error) {
 	lhs, err := p.parsePower()
 	if err != nil {
-		return new(big.Rat), err
+		return nil, err
 	}
 
 	for {
 		t := p.peek()
 		switch t.Typ {
-		case MUL:
-			p.consume(t.Typ)
-			rhs, err := p.parsePower()
-			if err != nil {
-				return new(big.Rat), err
-			}
-			lhs.Mul(lhs, rhs)
-		case QUO:
-			p.consume(t.Typ)
-			rhs, err := p.parsePower()
-			if err != nil {
-				return new(big.Rat), err
-			}
-			if rhs.Sign() == 0 {
-				return new(big.Rat), errors.New("division by zero in expression")
-			}
-			lhs.Quo(lhs, rhs)
-		case MODULO:
+		case MUL, QUO, MODULO:
 			p.consume(t.Typ)
 			rhs, err := p.parsePower()
 			if err != nil {
-				return new(big.Rat), err
+				return nil, err
 			}
-			if !lhs.IsInt() || !rhs.IsInt() {
-				return new(big.Rat), errors.New("modulo operator requires integer operands") // FIX: Improved error message
-			}
-			lhsNum := lhs.Num()
-			rhsNum := rhs.Num()
-			resultNum := new(big.Int).Rem(lhsNum, rhsNum)
-			lhs.SetInt(resultNum)
+			lhs = BinaryOp{Op: t.Typ, LHS: lhs, RHS: rhs}
 		default:
 			return lhs, nil
 		}
 	}
 }
 
-func (p *Parser) parsePower() (*big.Rat, error) {
+func (p *Parser) parsePower() (Node, error) {
 	lhs, err := p.parseUnary()
 	if err != nil {
-		return new(big.Rat), err
+		return nil, err
 	}
 	if p.peek().Typ == POWER {
 		p.consume(POWER)
 		rhs, err := p.parsePower()
 		if err != nil {
-			return new(big.Rat), err
+			return nil, err
 		}
-		return calculatePower(lhs, rhs)
+		return BinaryOp{Op: POWER, LHS: lhs, RHS: rhs}, nil
 	}
 
 	return lhs, nil
 }
 
-func (p *Parser) parseUnary() (*big.Rat, error) {
+func (p *Parser) parseUnary() (Node, error) {
 	t := p.peek()
 	if t.Typ == ADD {
 		p.consume(ADD)
@@ -331,13 +644,21 @@ func (p *Parser) parseUnary() (*big.Rat, error) {
 		if err != nil {
 			return nil, err
 		}
-		return new(big.Rat).Neg(val), nil
+		return UnaryOp{Op: SUB, X: val}, nil
+	}
+	if t.Typ == BNOT {
+		p.consume(BNOT)
+		val, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return UnaryOp{Op: BNOT, X: val}, nil
 	}
 
 	return p.parseAtom()
 }
 
-func (p *Parser) parseAtom() (*big.Rat, error) {
+func (p *Parser) parseAtom() (Node, error) {
 	t := p.peek()
 	switch t.Typ {
 	case NUM:
@@ -346,30 +667,114 @@ func (p *Parser) parseAtom() (*big.Rat, error) {
 		if _, ok := val.SetString(t.Value); !ok {
 			return nil, fmt.Errorf("invalid number format for big.Rat: %q", t.Value)
 		}
-		return val, nil
+		return NumLit{Value: val}, nil
+	case IDENT:
+		p.consume(t.Typ)
+		if p.peek().Typ != LPAREN {
+			return Ident{Name: t.Value}, nil
+		}
+		p.consume(LPAREN)
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(RPAREN); err != nil {
+			return nil, fmt.Errorf("missing closing parenthesis in call to %q: %w", t.Value, err)
+		}
+		return Call{Name: t.Value, Args: args}, nil
 	case LPAREN:
 		p.consume(t.Typ)
-		val, err := p.parseExpression()
+		val, err := p.parseBitOr()
 		if err != nil {
 			return nil, err
 		}
 		if _, err := p.consume(RPAREN); err != nil {
 			return nil, fmt.Errorf("missing closing parenthesis: %w", err)
 		}
-		return val, nil
+		return Paren{X: val}, nil
 	default:
 		if t.Typ == EOF {
-			return nil, errors.New("unexpected EOF. expected a number or parenthesis")
+			return nil, newParseError(p.source, t, "unexpected EOF, expected a number, identifier or parenthesis")
+		}
+		return nil, newParseError(p.source, t, "unexpected token %s in atom, expected number, identifier or '('", t)
+	}
+}
+
+func (p *Parser) parseArgs() ([]Node, error) {
+	if p.peek().Typ == RPAREN {
+		return nil, nil
+	}
+
+	var args []Node
+	for {
+		arg, err := p.parseBitOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().Typ != COMMA {
+			break
 		}
-		return nil, fmt.Errorf("unexpected token in atom: %s (expected number or '(')", t)
+		p.consume(COMMA)
 	}
+	return args, nil
+}
+
+// maxShiftCount bounds `<<`/`>>` shift amounts to guard against an absurdly
+// large count (e.g. `1 << 1000000000`) blowing up memory.
+const maxShiftCount = 1 << 20
+
+func bitwiseOpName(op TokenType) string {
+	switch op {
+	case BAND:
+		return "&"
+	case BOR:
+		return "|"
+	case BXOR:
+		return "^"
+	default:
+		return "bitwise operator"
+	}
+}
+
+func evalShift(op TokenType, lhs, rhs *big.Rat) (*big.Rat, error) {
+	name := "<<"
+	if op == SHR {
+		name = ">>"
+	}
+	lhsInt, err := requireInt(name, lhs)
+	if err != nil {
+		return nil, err
+	}
+	rhsInt, err := requireInt(name, rhs)
+	if err != nil {
+		return nil, err
+	}
+	if rhsInt.Sign() < 0 {
+		return nil, fmt.Errorf("%s: shift count %s must not be negative", name, rhsInt.String())
+	}
+	if !rhsInt.IsUint64() || rhsInt.Uint64() > maxShiftCount {
+		return nil, fmt.Errorf("%s: shift count %s is too large", name, rhsInt.String())
+	}
+	count := uint(rhsInt.Uint64())
+
+	result := new(big.Int)
+	if op == SHL {
+		result.Lsh(lhsInt, count)
+	} else {
+		result.Rsh(lhsInt, count)
+	}
+	return new(big.Rat).SetInt(result), nil
 }
 
 func calculatePower(base, exponent *big.Rat) (*big.Rat, error) {
 	if !exponent.IsInt() {
-		return nil, fmt.Errorf("exponent must be integer for power operation")
+		return calculateRationalPower(base, exponent)
 	}
-	expVal := exponent.Num()
+	return intPower(base, exponent.Num())
+}
+
+func intPower(base *big.Rat, expVal *big.Int) (*big.Rat, error) {
 	if base.Sign() == 0 && expVal.Sign() < 0 {
 		return nil, errors.New("math error: 0 raised to a negative power")
 	}
@@ -390,7 +795,295 @@ func calculatePower(base, exponent *big.Rat) (*big.Rat, error) {
 	return new(big.Rat).SetFrac(finalNum, finalDen), nil
 }
 
-func parseExpressionToRat(s string) (*big.Rat, error) {
+// maxRootDegree bounds the root degree q taken in calculateRationalPower,
+// guarding against an absurdly large exponent denominator (e.g.
+// `2 ** (1/100000000)`) making intNthRoot's Newton iteration, which computes
+// x**(n-1) on every step, run for an unbounded amount of CPU time.
+const maxRootDegree = 1 << 20
+
+// calculateRationalPower computes base**(p/q) for a non-integer exponent
+// p/q as nthRoot(base**p, q), preserving the exact-rational contract: the
+// result is returned only when the root is exact.
+func calculateRationalPower(base, exponent *big.Rat) (*big.Rat, error) {
+	p, q := exponent.Num(), exponent.Denom()
+	if base.Sign() < 0 && q.Bit(0) == 0 {
+		return nil, fmt.Errorf("negative base %s with even root %s is not real", base.RatString(), q.String())
+	}
+	if !q.IsUint64() || q.Uint64() > maxRootDegree {
+		return nil, fmt.Errorf("root degree %s is too large", q.String())
+	}
+
+	inner, err := intPower(base, p)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := nthRoot(inner, uint(q.Uint64()))
+	if !ok {
+		return nil, fmt.Errorf("%s ** (%s) is not an exact rational", base.RatString(), exponent.RatString())
+	}
+	return root, nil
+}
+
+// nthRoot returns the exact rational nth root of x, taking integer nth
+// roots of its numerator and denominator separately. It returns (nil,
+// false) if either root is not exact.
+func nthRoot(x *big.Rat, n uint) (*big.Rat, bool) {
+	numRoot, ok := intNthRoot(x.Num(), n)
+	if !ok {
+		return nil, false
+	}
+	denRoot, ok := intNthRoot(x.Denom(), n)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(numRoot, denRoot), true
+}
+
+// intNthRoot returns the exact integer nth root of a via Newton's method:
+// starting from a power-of-two upper bound, iterate
+// y := ((n-1)*x + a/x**(n-1)) / n until y >= x, then verify x**n == a.
+func intNthRoot(a *big.Int, n uint) (*big.Int, bool) {
+	if a.Sign() < 0 {
+		if n%2 == 0 {
+			return nil, false
+		}
+		root, ok := intNthRoot(new(big.Int).Neg(a), n)
+		if !ok {
+			return nil, false
+		}
+		return new(big.Int).Neg(root), true
+	}
+	if a.Sign() == 0 {
+		return new(big.Int), true
+	}
+
+	nBig := new(big.Int).SetUint64(uint64(n))
+	nMinusOne := new(big.Int).SetUint64(uint64(n - 1))
+	x := new(big.Int).Lsh(big.NewInt(1), uint(a.BitLen()/int(n)+1))
+	for {
+		xPow := new(big.Int).Exp(x, nMinusOne, nil)
+		y := new(big.Int).Mul(nMinusOne, x)
+		y.Add(y, new(big.Int).Div(a, xPow))
+		y.Div(y, nBig)
+		if y.Cmp(x) >= 0 {
+			break
+		}
+		x = y
+	}
+
+	if new(big.Int).Exp(x, nBig, nil).Cmp(a) == 0 {
+		return x, true
+	}
+	return nil, false
+}
+
+func lookupFunc(name string, env *Env) (Func, bool) {
+	if env != nil {
+		if fn, ok := env.Funcs[name]; ok {
+			return fn, true
+		}
+	}
+	fn, ok := DefaultFuncs[name]
+	return fn, ok
+}
+
+func requireInt(fnName string, r *big.Rat) (*big.Int, error) {
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%s: operand %s is not an integer", fnName, r.RatString())
+	}
+	return r.Num(), nil
+}
+
+func requireArgCount(fnName string, args []*big.Rat, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%s: expected %d argument(s), got %d", fnName, n, len(args))
+	}
+	return nil
+}
+
+// isqrt returns the integer square root of a non-negative big.Int via
+// Newton's method.
+func isqrt(x *big.Int) *big.Int {
+	if x.Sign() == 0 {
+		return new(big.Int)
+	}
+	b := new(big.Int).Set(x)
+	two := big.NewInt(2)
+	for {
+		a := new(big.Int).Set(b)
+		b = new(big.Int).Div(x, a)
+		b.Add(b, a)
+		b.Div(b, two)
+		if b.Cmp(a) >= 0 {
+			return a
+		}
+	}
+}
+
+// DefaultFuncs is the built-in set of functions available to expressions
+// unless overridden by an Env's Funcs registry.
+var DefaultFuncs = FuncRegistry{
+	"abs": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("abs", args, 1); err != nil {
+			return nil, err
+		}
+		return new(big.Rat).Abs(args[0]), nil
+	},
+	"min": func(args ...*big.Rat) (*big.Rat, error) {
+		if len(args) == 0 {
+			return nil, errors.New("min: expected at least 1 argument, got 0")
+		}
+		m := args[0]
+		for _, a := range args[1:] {
+			if a.Cmp(m) < 0 {
+				m = a
+			}
+		}
+		return new(big.Rat).Set(m), nil
+	},
+	"max": func(args ...*big.Rat) (*big.Rat, error) {
+		if len(args) == 0 {
+			return nil, errors.New("max: expected at least 1 argument, got 0")
+		}
+		m := args[0]
+		for _, a := range args[1:] {
+			if a.Cmp(m) > 0 {
+				m = a
+			}
+		}
+		return new(big.Rat).Set(m), nil
+	},
+	"gcd": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("gcd", args, 2); err != nil {
+			return nil, err
+		}
+		a, err := requireInt("gcd", args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := requireInt("gcd", args[1])
+		if err != nil {
+			return nil, err
+		}
+		result := new(big.Int).GCD(nil, nil, new(big.Int).Abs(a), new(big.Int).Abs(b))
+		return new(big.Rat).SetInt(result), nil
+	},
+	"lcm": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("lcm", args, 2); err != nil {
+			return nil, err
+		}
+		a, err := requireInt("lcm", args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := requireInt("lcm", args[1])
+		if err != nil {
+			return nil, err
+		}
+		a = new(big.Int).Abs(a)
+		b = new(big.Int).Abs(b)
+		if a.Sign() == 0 || b.Sign() == 0 {
+			return new(big.Rat), nil
+		}
+		gcd := new(big.Int).GCD(nil, nil, a, b)
+		result := new(big.Int).Div(a, gcd)
+		result.Mul(result, b)
+		return new(big.Rat).SetInt(result), nil
+	},
+	"floor": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("floor", args, 1); err != nil {
+			return nil, err
+		}
+		x := args[0]
+		q := new(big.Int)
+		r := new(big.Int)
+		q.QuoRem(x.Num(), x.Denom(), r)
+		if r.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		}
+		return new(big.Rat).SetInt(q), nil
+	},
+	"ceil": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("ceil", args, 1); err != nil {
+			return nil, err
+		}
+		x := args[0]
+		q := new(big.Int)
+		r := new(big.Int)
+		q.QuoRem(x.Num(), x.Denom(), r)
+		if r.Sign() > 0 {
+			q.Add(q, big.NewInt(1))
+		}
+		return new(big.Rat).SetInt(q), nil
+	},
+	"trunc": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("trunc", args, 1); err != nil {
+			return nil, err
+		}
+		q := new(big.Int).Quo(args[0].Num(), args[0].Denom())
+		return new(big.Rat).SetInt(q), nil
+	},
+	"round": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("round", args, 1); err != nil {
+			return nil, err
+		}
+		x := args[0]
+		half := big.NewRat(1, 2)
+		shifted := new(big.Rat).Add(x, half)
+		q := new(big.Int)
+		r := new(big.Int)
+		q.QuoRem(shifted.Num(), shifted.Denom(), r)
+		if r.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		}
+		return new(big.Rat).SetInt(q), nil
+	},
+	"numer": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("numer", args, 1); err != nil {
+			return nil, err
+		}
+		return new(big.Rat).SetInt(args[0].Num()), nil
+	},
+	"denom": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("denom", args, 1); err != nil {
+			return nil, err
+		}
+		return new(big.Rat).SetInt(args[0].Denom()), nil
+	},
+	"isqrt": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("isqrt", args, 1); err != nil {
+			return nil, err
+		}
+		x, err := requireInt("isqrt", args[0])
+		if err != nil {
+			return nil, err
+		}
+		if x.Sign() < 0 {
+			return nil, errors.New("isqrt: operand must be non-negative")
+		}
+		return new(big.Rat).SetInt(isqrt(x)), nil
+	},
+	"sqrt": func(args ...*big.Rat) (*big.Rat, error) {
+		if err := requireArgCount("sqrt", args, 1); err != nil {
+			return nil, err
+		}
+		x := args[0]
+		if x.Sign() < 0 {
+			return nil, errors.New("sqrt: operand must be non-negative")
+		}
+		numRoot := isqrt(x.Num())
+		denRoot := isqrt(x.Denom())
+		if new(big.Int).Mul(numRoot, numRoot).Cmp(x.Num()) != 0 ||
+			new(big.Int).Mul(denRoot, denRoot).Cmp(x.Denom()) != 0 {
+			return nil, fmt.Errorf("sqrt: %s is not a perfect rational square", x.RatString())
+		}
+		return new(big.Rat).SetFrac(numRoot, denRoot), nil
+	},
+}
+
+// Parse turns an expression string into an AST. Evaluate the result with
+// Eval, possibly more than once and against different Envs.
+func Parse(s string) (Node, error) {
 	tokens, err := scanAll(s)
 	if err != nil {
 		return nil, fmt.Errorf("scanAll failed for %q: %w", s, err)
@@ -407,13 +1100,166 @@ func parseExpressionToRat(s string) (*big.Rat, error) {
 	}
 
 	p := NewParser(tokens)
-	ret, err := p.parseExpression()
+	p.source = s
+	node, err := p.parseBitOr()
 	if err != nil {
 		return nil, fmt.Errorf("parseExpression failed for %q: %w", s, err)
 	}
-	if p.peek().Typ != EOF {
-		return nil, fmt.Errorf("unexpected trailling tokens starting with: %s in %q", p.peek(), s)
+	if trailing := p.peek(); trailing.Typ != EOF {
+		return nil, newParseError(s, trailing, "unexpected trailing token %s", trailing)
+	}
+
+	return node, nil
+}
+
+// Eval walks a Node tree produced by Parse and computes its exact rational
+// value against env. env may be nil for expressions that reference no
+// variables.
+func Eval(node Node, env *Env) (*big.Rat, error) {
+	switch n := node.(type) {
+	case NumLit:
+		return new(big.Rat).Set(n.Value), nil
+	case Ident:
+		if env != nil {
+			if val, ok := env.Vars[n.Name]; ok {
+				return new(big.Rat).Set(val), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown identifier %q: no binding in env", n.Name)
+	case Call:
+		fn, ok := lookupFunc(n.Name, env)
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", n.Name)
+		}
+		args := make([]*big.Rat, len(n.Args))
+		for i, argNode := range n.Args {
+			arg, err := Eval(argNode, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = arg
+		}
+		val, err := fn(args...)
+		if err != nil {
+			return nil, fmt.Errorf("calling %q: %w", n.Name, err)
+		}
+		return val, nil
+	case Paren:
+		return Eval(n.X, env)
+	case UnaryOp:
+		val, err := Eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case SUB:
+			return new(big.Rat).Neg(val), nil
+		case BNOT:
+			valInt, err := requireInt("~", val)
+			if err != nil {
+				return nil, err
+			}
+			return new(big.Rat).SetInt(new(big.Int).Not(valInt)), nil
+		default:
+			return nil, fmt.Errorf("unsupported unary operator: %v", n.Op)
+		}
+	case BinaryOp:
+		lhs, err := Eval(n.LHS, env)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := Eval(n.RHS, env)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case ADD:
+			return new(big.Rat).Add(lhs, rhs), nil
+		case SUB:
+			return new(big.Rat).Sub(lhs, rhs), nil
+		case MUL:
+			return new(big.Rat).Mul(lhs, rhs), nil
+		case QUO:
+			if rhs.Sign() == 0 {
+				return nil, errors.New("division by zero in expression")
+			}
+			return new(big.Rat).Quo(lhs, rhs), nil
+		case MODULO:
+			if !lhs.IsInt() || !rhs.IsInt() {
+				return nil, errors.New("modulo operator requires integer operands")
+			}
+			if rhs.Sign() == 0 {
+				return nil, errors.New("modulo by zero in expression")
+			}
+			result := new(big.Int).Rem(lhs.Num(), rhs.Num())
+			return new(big.Rat).SetInt(result), nil
+		case POWER:
+			return calculatePower(lhs, rhs)
+		case BAND, BOR, BXOR:
+			lhsInt, err := requireInt(bitwiseOpName(n.Op), lhs)
+			if err != nil {
+				return nil, err
+			}
+			rhsInt, err := requireInt(bitwiseOpName(n.Op), rhs)
+			if err != nil {
+				return nil, err
+			}
+			result := new(big.Int)
+			switch n.Op {
+			case BAND:
+				result.And(lhsInt, rhsInt)
+			case BOR:
+				result.Or(lhsInt, rhsInt)
+			case BXOR:
+				result.Xor(lhsInt, rhsInt)
+			}
+			return new(big.Rat).SetInt(result), nil
+		case SHL, SHR:
+			return evalShift(n.Op, lhs, rhs)
+		default:
+			return nil, fmt.Errorf("unsupported binary operator: %v", n.Op)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported node type: %T", node)
+	}
+}
+
+// Program is an expression parsed once and ready to be evaluated repeatedly
+// against different variable bindings via Eval.
+type Program struct {
+	node   Node
+	source string
+	// Funcs, if set, is consulted before DefaultFuncs when resolving calls
+	// in the program, the same way Env.Funcs is for the lower-level Eval.
+	Funcs FuncRegistry
+}
+
+// Compile parses s into a Program. Identifiers in s (e.g. "a*x**2 + b*x + c")
+// are left unresolved until Eval, so the same Program can be evaluated many
+// times with different bindings.
+func Compile(s string) (*Program, error) {
+	node, err := Parse(s)
+	if err != nil {
+		return nil, err
 	}
+	return &Program{node: node, source: s}, nil
+}
 
-	return ret, nil
+// Eval evaluates the compiled program against env, the bindings for any
+// identifiers referenced in the expression. Referencing a name absent from
+// env returns a descriptive error naming the missing binding.
+func (pr *Program) Eval(env map[string]*big.Rat) (*big.Rat, error) {
+	val, err := Eval(pr.node, &Env{Vars: env, Funcs: pr.Funcs})
+	if err != nil {
+		return nil, fmt.Errorf("evaluating %q: %w", pr.source, err)
+	}
+	return val, nil
+}
+
+func parseExpressionToRat(s string) (*big.Rat, error) {
+	node, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return Eval(node, nil)
 }
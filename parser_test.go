@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -129,6 +131,10 @@ func TestRatFromExpr(t *testing.T) {
 				return "3"
 			},
 		},
+		{
+			expr:    Expr{Num: "5 % 0"},
+			wantErr: true,
+		},
 		{
 			expr:    Expr{Num: "2 * 3 ** 2"},
 			wantErr: false,
@@ -208,3 +214,284 @@ func TestRatFromExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestProgramEval(t *testing.T) {
+	t.Parallel()
+
+	for i, tt := range []struct {
+		expr    string
+		env     map[string]*big.Rat
+		want    string
+		wantErr bool
+	}{
+		{
+			expr: "a*x**2 + b*x + c",
+			env: map[string]*big.Rat{
+				"a": big.NewRat(1, 1),
+				"b": big.NewRat(2, 1),
+				"c": big.NewRat(3, 1),
+				"x": big.NewRat(5, 1),
+			},
+			want: "38",
+		},
+		{
+			expr: "x / 2",
+			env: map[string]*big.Rat{
+				"x": big.NewRat(5, 1),
+			},
+			want: "5/2",
+		},
+		{
+			expr:    "x + y",
+			env:     map[string]*big.Rat{"x": big.NewRat(1, 1)},
+			wantErr: true,
+		},
+	} {
+		t.Run(fmt.Sprintf("%d[%s]", i+1, tt.expr), func(t *testing.T) {
+			program, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			got, err := program.Eval(tt.env)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("Eval() = %v, wantErr %v", got, tt.wantErr)
+				return
+			}
+			if got.RatString() != tt.want {
+				t.Errorf("Eval() = %v, want %v", got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestProgramEvalWithFuncs(t *testing.T) {
+	t.Parallel()
+
+	program, err := Compile("double(x) + 1")
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	program.Funcs = FuncRegistry{
+		"double": func(args ...*big.Rat) (*big.Rat, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("double: want 1 arg, got %d", len(args))
+			}
+			return new(big.Rat).Add(args[0], args[0]), nil
+		},
+	}
+
+	got, err := program.Eval(map[string]*big.Rat{"x": big.NewRat(5, 1)})
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if want := "11"; got.RatString() != want {
+		t.Errorf("Eval() = %v, want %v", got.RatString(), want)
+	}
+}
+
+func TestBuiltinFuncCalls(t *testing.T) {
+	t.Parallel()
+
+	for i, tt := range []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "sqrt(16)", want: "4"},
+		{expr: "sqrt(1/4)", want: "1/2"},
+		{expr: "sqrt(2)", wantErr: true},
+		{expr: "isqrt(10)", want: "3"},
+		{expr: "abs(-5)", want: "5"},
+		{expr: "min(3, 1, 2)", want: "1"},
+		{expr: "max(3, 1, 2)", want: "3"},
+		{expr: "gcd(12, 18)", want: "6"},
+		{expr: "lcm(4, 6)", want: "12"},
+		{expr: "floor(3/2)", want: "1"},
+		{expr: "ceil(3/2)", want: "2"},
+		{expr: "round(3/2)", want: "2"},
+		{expr: "trunc(-3/2)", want: "-1"},
+		{expr: "numer(3/4)", want: "3"},
+		{expr: "denom(3/4)", want: "4"},
+		{expr: "gcd(3/2, 2)", wantErr: true},
+		{expr: "nope(1)", wantErr: true},
+	} {
+		t.Run(fmt.Sprintf("%d[%s]", i+1, tt.expr), func(t *testing.T) {
+			node, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := Eval(node, nil)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("Eval() = %v, wantErr %v", got, tt.wantErr)
+				return
+			}
+			if got.RatString() != tt.want {
+				t.Errorf("Eval() = %v, want %v", got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBitwiseOps(t *testing.T) {
+	t.Parallel()
+
+	for i, tt := range []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "6 & 3", want: "2"},
+		{expr: "6 | 1", want: "7"},
+		{expr: "6 ^ 3", want: "5"},
+		{expr: "~0", want: "-1"},
+		{expr: "1 << 4", want: "16"},
+		{expr: "256 >> 4", want: "16"},
+		{expr: "1 << 2 + 1", want: "8"},
+		{expr: "1 | 2 & 3", want: "3"},
+		{expr: "1 ^ 2 | 4", want: "7"},
+		{expr: "-1 << 2", want: "-4"},
+		{expr: "1 << -1", wantErr: true},
+		{expr: "1.5 & 1", wantErr: true},
+	} {
+		t.Run(fmt.Sprintf("%d[%s]", i+1, tt.expr), func(t *testing.T) {
+			node, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := Eval(node, nil)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("Eval() = %v, wantErr %v", got, tt.wantErr)
+				return
+			}
+			if got.RatString() != tt.want {
+				t.Errorf("Eval() = %v, want %v", got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorSnippet(t *testing.T) {
+	t.Parallel()
+
+	expr := "1 + * 2"
+	_, err := Parse(expr)
+	if err == nil {
+		t.Fatalf("Parse() error = nil, want error")
+	}
+
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Parse() error = %v, want *ParseError in chain", err)
+	}
+	if perr.Line != 1 || perr.Col != 5 {
+		t.Errorf("ParseError position = %d:%d, want 1:5", perr.Line, perr.Col)
+	}
+	wantSnippet := expr + "\n    ^"
+	if !strings.Contains(perr.Error(), wantSnippet) {
+		t.Errorf("ParseError.Error() = %q, want it to contain %q", perr.Error(), wantSnippet)
+	}
+}
+
+func TestExtendedNumericLiterals(t *testing.T) {
+	t.Parallel()
+
+	for i, tt := range []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "1.5e-3", want: "3/2000"},
+		{expr: "2E10", want: "20000000000"},
+		{expr: "1_000_000", want: "1000000"},
+		{expr: "0.000_1", want: "1/10000"},
+		{expr: "0x1A", want: "26"},
+		{expr: "0b101", want: "5"},
+		{expr: "0o17", want: "15"},
+		{expr: "0x_FF + 1", want: "256"},
+		{expr: "1__2", wantErr: true},
+		{expr: "1_", wantErr: true},
+		{expr: "0x", wantErr: true},
+	} {
+		t.Run(fmt.Sprintf("%d[%s]", i+1, tt.expr), func(t *testing.T) {
+			node, err := Parse(tt.expr)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			got, err := Eval(node, nil)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("Eval() = %v, wantErr %v", got, tt.wantErr)
+				return
+			}
+			if got.RatString() != tt.want {
+				t.Errorf("Eval() = %v, want %v", got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRationalExponent(t *testing.T) {
+	t.Parallel()
+
+	for i, tt := range []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "4 ** (1/2)", want: "2"},
+		{expr: "8 ** (1/3)", want: "2"},
+		{expr: "(1/4) ** (1/2)", want: "1/2"},
+		{expr: "(-8) ** (1/3)", want: "-2"},
+		{expr: "2 ** (1/2)", wantErr: true},
+		{expr: "(-4) ** (1/2)", wantErr: true},
+		{expr: "2 ** (1/1048577)", wantErr: true},
+	} {
+		t.Run(fmt.Sprintf("%d[%s]", i+1, tt.expr), func(t *testing.T) {
+			node, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := Eval(node, nil)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("Eval() = %v, wantErr %v", got, tt.wantErr)
+				return
+			}
+			if got.RatString() != tt.want {
+				t.Errorf("Eval() = %v, want %v", got.RatString(), tt.want)
+			}
+		})
+	}
+}